@@ -0,0 +1,104 @@
+// Package buffer provides a pooled, growable byte buffer for building log
+// lines without the per-field allocations fmt.Sprintf incurs. It mirrors
+// the small slice of go.uber.org/zap/buffer's API that zapcolors needs.
+package buffer
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCap = 4096
+	// maxPooledCap bounds how large a buffer the pool will hang onto. A
+	// single oversized entry (a huge payload, a deep stack trace) would
+	// otherwise pin that memory in the pool for the life of the process.
+	maxPooledCap = 64 * 1024
+)
+
+// Buffer is a []byte wrapper with allocation-free append helpers for the
+// value types the text encoder writes.
+type Buffer struct {
+	bs []byte
+}
+
+func newBuffer() *Buffer {
+	return &Buffer{bs: make([]byte, 0, defaultCap)}
+}
+
+// AppendByte appends a single byte.
+func (b *Buffer) AppendByte(c byte) {
+	b.bs = append(b.bs, c)
+}
+
+// AppendString appends s.
+func (b *Buffer) AppendString(s string) {
+	b.bs = append(b.bs, s...)
+}
+
+// AppendInt appends the base-10 form of i.
+func (b *Buffer) AppendInt(i int64) {
+	b.bs = strconv.AppendInt(b.bs, i, 10)
+}
+
+// AppendUint appends the base-10 form of i.
+func (b *Buffer) AppendUint(i uint64) {
+	b.bs = strconv.AppendUint(b.bs, i, 10)
+}
+
+// AppendBool appends "true" or "false".
+func (b *Buffer) AppendBool(v bool) {
+	b.bs = strconv.AppendBool(b.bs, v)
+}
+
+// AppendFloat64 appends the shortest decimal form of f that round-trips.
+func (b *Buffer) AppendFloat64(f float64) {
+	b.bs = strconv.AppendFloat(b.bs, f, 'f', -1, 64)
+}
+
+// AppendTime appends t formatted with layout (the same layout strings
+// time.Parse accepts).
+func (b *Buffer) AppendTime(t time.Time, layout string) {
+	b.bs = t.AppendFormat(b.bs, layout)
+}
+
+// Truncate discards everything after the first n bytes.
+func (b *Buffer) Truncate(n int) {
+	b.bs = b.bs[:n]
+}
+
+// Write implements io.Writer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.bs = append(b.bs, p...)
+	return len(p), nil
+}
+
+// Bytes returns the buffer's contents.
+func (b *Buffer) Bytes() []byte { return b.bs }
+
+// Len returns the number of bytes written so far.
+func (b *Buffer) Len() int { return len(b.bs) }
+
+// Cap returns the capacity of the backing array.
+func (b *Buffer) Cap() int { return cap(b.bs) }
+
+// Reset clears the buffer's contents without releasing its backing array.
+func (b *Buffer) Reset() { b.bs = b.bs[:0] }
+
+var pool = sync.Pool{New: func() interface{} { return newBuffer() }}
+
+// Get returns a reset Buffer from the pool.
+func Get() *Buffer {
+	b := pool.Get().(*Buffer)
+	b.Reset()
+	return b
+}
+
+// Put returns buf to the pool, unless it has grown past maxPooledCap.
+func Put(buf *Buffer) {
+	if buf.Cap() > maxPooledCap {
+		return
+	}
+	pool.Put(buf)
+}
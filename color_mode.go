@@ -0,0 +1,96 @@
+package zapcolors
+
+import (
+	"os"
+	"strings"
+)
+
+// ColorMode selects how (and whether) the encoder emits ANSI color escapes
+// for keys and level labels.
+type ColorMode int
+
+const (
+	// ColorAuto detects terminal capability from the destination and the
+	// environment (TERM, COLORTERM) and picks the richest palette the
+	// terminal supports. This is the default.
+	ColorAuto ColorMode = iota
+	// ColorOff disables color entirely; appendColoredKey/addLevel emit no
+	// escape bytes at all.
+	ColorOff
+	// ColorANSI16 emits the classic 8/16-color SGR codes (30-37).
+	ColorANSI16
+	// ColorANSI256 emits 256-color SGR codes (38;5;N) for keys; level
+	// labels keep the 16-color codes.
+	ColorANSI256
+	// ColorTrueColor emits 24-bit RGB SGR codes (38;2;R;G;B) for keys;
+	// level labels keep the 16-color codes.
+	ColorTrueColor
+)
+
+// TextColorMode sets the color palette the encoder emits. The default is
+// ColorAuto, which probes the process environment for terminal capability.
+func TextColorMode(mode ColorMode) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		enc.colorMode = mode
+	})
+}
+
+// TextForceColor(true) forces color output on under ColorAuto (bypassing
+// the non-TTY checks ColorAuto would otherwise apply, to os.Stdout and to
+// the sink), leaving the palette to TERM/COLORTERM alone. TextForceColor(false)
+// is the default and keeps those checks; it does not turn color off
+// (TextColorMode(ColorOff) does). An explicit TextColorMode other than
+// ColorAuto is used as-is either way, and TextFallbackJSON still switches a
+// non-terminal sink to JSON. It's useful for programs that know they're
+// writing to something that understands color (e.g. a pty-backed test
+// harness) even though stdout isn't directly a terminal.
+func TextForceColor(force bool) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		enc.forceColor = force
+	})
+}
+
+// detectColorMode inspects the environment to decide how rich a palette a
+// terminal-attached stdout supports. It does not itself check TTY-ness;
+// callers that have a concrete destination should do that first and pass
+// ColorOff when it isn't a terminal.
+func detectColorMode() ColorMode {
+	colorterm := os.Getenv("COLORTERM")
+	if colorterm == "truecolor" || colorterm == "24bit" {
+		return ColorTrueColor
+	}
+
+	term := os.Getenv("TERM")
+	switch {
+	case term == "" || term == "dumb":
+		return ColorOff
+	case strings.Contains(term, "256color"):
+		return ColorANSI256
+	default:
+		return ColorANSI16
+	}
+}
+
+// resolveColorMode turns the configured mode/force settings into a concrete
+// palette, probing stdout's TTY-ness for ColorAuto. The non-TTY check is
+// scoped to ColorAuto only, matching TextForceColor's doc comment ("bypassing
+// the non-TTY checks ColorAuto would otherwise apply"): an explicit
+// TextColorMode(ColorANSI256) (say) is honored exactly as configured and
+// never silently downgraded to ColorOff because the destination isn't a
+// terminal. The result is computed once, when NewColorEncoder builds the
+// encoder and before the eventual sink is known, so auto-detection here is
+// anchored to os.Stdout, the overwhelmingly common destination for NewColorEncoder;
+// WriteEntry additionally re-checks the real sink for ColorAuto (see
+// textEncoder.effectiveColorMode), so a program whose stdout is a terminal
+// but that also writes to a non-TTY sink (a log file, NewRotatingSink) still
+// gets plain output there. Callers writing elsewhere from the start should
+// pin the mode explicitly with TextColorMode or TextForceColor.
+func resolveColorMode(mode ColorMode, force bool) ColorMode {
+	if mode != ColorAuto {
+		return mode
+	}
+	if !force && !isTerminal(os.Stdout.Fd()) {
+		return ColorOff
+	}
+	return detectColorMode()
+}
@@ -0,0 +1,105 @@
+package zapcolors
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectColorMode(t *testing.T) {
+	cases := []struct {
+		name      string
+		colorterm string
+		term      string
+		want      ColorMode
+	}{
+		{"truecolor env", "truecolor", "xterm", ColorTrueColor},
+		{"24bit env", "24bit", "xterm", ColorTrueColor},
+		{"empty term", "", "", ColorOff},
+		{"dumb term", "", "dumb", ColorOff},
+		{"256color term", "", "xterm-256color", ColorANSI256},
+		{"plain term", "", "xterm", ColorANSI16},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("COLORTERM", tc.colorterm)
+			t.Setenv("TERM", tc.term)
+
+			if got := detectColorMode(); got != tc.want {
+				t.Fatalf("detectColorMode() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestResolveColorMode_ExplicitModeNeverDowngraded guards against
+// resolveColorMode silently downgrading an explicit, non-ColorAuto mode to
+// ColorOff just because os.Stdout isn't a terminal (as it reliably isn't
+// under `go test`) - only ColorAuto is meant to probe TTY-ness.
+func TestResolveColorMode_ExplicitModeNeverDowngraded(t *testing.T) {
+	for _, mode := range []ColorMode{ColorANSI16, ColorANSI256, ColorTrueColor} {
+		if got := resolveColorMode(mode, false); got != mode {
+			t.Fatalf("resolveColorMode(%v, false) = %v, want %v unchanged", mode, got, mode)
+		}
+	}
+}
+
+func TestResolveColorMode_Off(t *testing.T) {
+	if got := resolveColorMode(ColorOff, true); got != ColorOff {
+		t.Fatalf("resolveColorMode(ColorOff, true) = %v, want ColorOff", got)
+	}
+}
+
+// TestResolveColorMode_AutoWithoutForceIsOffUnderTest relies on os.Stdout
+// not being a terminal in the test runner, which is true in every CI/local
+// `go test` invocation.
+func TestResolveColorMode_AutoWithoutForceIsOffUnderTest(t *testing.T) {
+	if got := resolveColorMode(ColorAuto, false); got != ColorOff {
+		t.Fatalf("resolveColorMode(ColorAuto, false) = %v, want ColorOff", got)
+	}
+}
+
+func TestResolveColorMode_AutoWithForceDetectsFromEnv(t *testing.T) {
+	t.Setenv("COLORTERM", "truecolor")
+	t.Setenv("TERM", "xterm")
+
+	if got := resolveColorMode(ColorAuto, true); got != ColorTrueColor {
+		t.Fatalf("resolveColorMode(ColorAuto, true) = %v, want ColorTrueColor", got)
+	}
+}
+
+// TestEffectiveColorMode checks textEncoder.effectiveColorMode's three
+// cases: an explicit mode is honored regardless of the sink, ColorAuto
+// without TextForceColor re-checks the real sink (and downgrades for a
+// non-terminal one like the bytes.Buffer here, regardless of what
+// enc.resolved was anchored to at construction), and ColorAuto with
+// TextForceColor bypasses that check entirely.
+func TestEffectiveColorMode(t *testing.T) {
+	var buf bytes.Buffer // non-terminal: no Fd() method
+
+	t.Run("explicit mode ignores sink", func(t *testing.T) {
+		enc := NewColorEncoder(TextColorMode(ColorANSI256)).(*textEncoder)
+		defer enc.Free()
+		if got := enc.effectiveColorMode(&buf); got != ColorANSI256 {
+			t.Fatalf("effectiveColorMode() = %v, want ColorANSI256", got)
+		}
+	})
+
+	t.Run("auto without force downgrades for non-terminal sink", func(t *testing.T) {
+		enc := NewColorEncoder(TextColorMode(ColorAuto), TextForceColor(false)).(*textEncoder)
+		defer enc.Free()
+		enc.resolved = ColorTrueColor // as if os.Stdout had been a terminal at construction
+		if got := enc.effectiveColorMode(&buf); got != ColorOff {
+			t.Fatalf("effectiveColorMode() = %v, want ColorOff", got)
+		}
+	})
+
+	t.Run("auto with force ignores sink", func(t *testing.T) {
+		enc := NewColorEncoder(TextColorMode(ColorAuto), TextForceColor(true)).(*textEncoder)
+		defer enc.Free()
+		enc.resolved = ColorTrueColor
+		if got := enc.effectiveColorMode(&buf); got != ColorTrueColor {
+			t.Fatalf("effectiveColorMode() = %v, want ColorTrueColor", got)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package zapcolors
+
+import "io"
+
+// NewColorable returns w unchanged. Every terminal zapcolors targets outside
+// of Windows already understands ANSI SGR escapes natively, so there's
+// nothing to translate.
+func NewColorable(w io.Writer) io.Writer {
+	return w
+}
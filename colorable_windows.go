@@ -0,0 +1,139 @@
+//go:build windows
+// +build windows
+
+package zapcolors
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procSetConsoleTextAttribute    = kernel32.NewProc("SetConsoleTextAttribute")
+)
+
+type consoleScreenBufferInfo struct {
+	size              [2]int16
+	cursorPosition    [2]int16
+	attributes        uint16
+	window            [4]int16
+	maximumWindowSize [2]int16
+}
+
+const (
+	foregroundBlue      = 0x0001
+	foregroundGreen     = 0x0002
+	foregroundRed       = 0x0004
+	foregroundIntensity = 0x0008
+)
+
+var ansiToWindows = map[int]uint16{
+	30: 0,
+	31: foregroundRed,
+	32: foregroundGreen,
+	33: foregroundRed | foregroundGreen,
+	34: foregroundBlue,
+	35: foregroundRed | foregroundBlue,
+	36: foregroundGreen | foregroundBlue,
+	37: foregroundRed | foregroundGreen | foregroundBlue,
+}
+
+// colorableWriter wraps a Windows console handle, translating the ANSI SGR
+// escapes zapcolors emits into calls against the legacy console API. This is
+// a minimal analogue of mattn/go-colorable's NewColorable: it only
+// understands reset, bold, and 16-color foreground (30-37), the codes
+// appendColoredKey/addLevel produce under ColorANSI16, not a general-purpose
+// ANSI parser. Each ';'-separated parameter is handled on its own, so the
+// 38;5;N and 38;2;R;G;B key colors of ColorANSI256/ColorTrueColor are not
+// translated into colors.
+type colorableWriter struct {
+	fd    syscall.Handle
+	out   io.Writer
+	bold  bool
+	fg    uint16
+	plain uint16 // attributes with no color/bold applied
+}
+
+// NewColorable wraps w so that ANSI color escapes are translated into
+// Windows console API calls on legacy consoles that don't understand them
+// natively (cmd.exe, older conhost). If w isn't backed by a console handle,
+// it's returned unchanged.
+func NewColorable(w io.Writer) io.Writer {
+	f, ok := w.(interface{ Fd() uintptr })
+	if !ok {
+		return w
+	}
+	fd := syscall.Handle(f.Fd())
+
+	var info consoleScreenBufferInfo
+	r, _, _ := procGetConsoleScreenBufferInfo.Call(uintptr(fd), uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return w
+	}
+
+	return &colorableWriter{fd: fd, out: w, plain: info.attributes}
+}
+
+func (cw *colorableWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, 0x1b)
+		if idx < 0 {
+			if _, err := cw.out.Write(p); err != nil {
+				return total, err
+			}
+			break
+		}
+		if idx > 0 {
+			if _, err := cw.out.Write(p[:idx]); err != nil {
+				return total, err
+			}
+		}
+		p = p[idx:]
+
+		end := bytes.IndexByte(p, 'm')
+		if len(p) < 2 || p[1] != '[' || end < 0 {
+			// Not a recognized SGR sequence; write it through verbatim.
+			if _, err := cw.out.Write(p[:1]); err != nil {
+				return total, err
+			}
+			p = p[1:]
+			continue
+		}
+
+		cw.applySGR(string(p[2:end]))
+		p = p[end+1:]
+	}
+	return total, nil
+}
+
+func (cw *colorableWriter) applySGR(codes string) {
+	for _, code := range strings.Split(codes, ";") {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 0:
+			cw.bold, cw.fg = false, 0
+		case n == 1:
+			cw.bold = true
+		case n >= 30 && n <= 37:
+			cw.fg = ansiToWindows[n]
+		}
+	}
+
+	attr := cw.plain
+	if cw.fg != 0 || cw.bold {
+		attr = cw.fg
+		if cw.bold {
+			attr |= foregroundIntensity
+		}
+	}
+	procSetConsoleTextAttribute.Call(uintptr(cw.fd), uintptr(attr))
+}
@@ -5,51 +5,100 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/aarondl/zapcolors/buffer"
 	"github.com/uber-go/zap"
 )
 
-const initialBufSize = 4096
-
 var textPool = sync.Pool{New: func() interface{} {
-	return &textEncoder{
-		bytes: make([]byte, 0, initialBufSize),
-	}
+	return &textEncoder{}
 }}
 
+// field is a single key/value pair added to an encoder. val is boxed
+// (string, bool, int64, uint64, uintptr, float64, marshaledFields, or
+// prerendered) and is
+// only turned into bytes at flush time, once TextFieldFormatter/
+// TextFieldOrder/TextPartsExclude have had a chance to act on it.
+type field struct {
+	key string
+	val interface{}
+}
+
+// prerendered marks a field value that's already fully formatted text.
+// WriteEntry emits it as-is rather than running it through the default
+// stringification or a registered formatter.
+type prerendered string
+
+// marshaledFields holds the fields a nested AddMarshaler call collected, to
+// be rendered as "{k=v k=v}" at WriteEntry time rather than baked into bytes
+// when AddMarshaler is called. Coloring a nested field eagerly would fix its
+// palette to whatever enc.resolved happened to be at Add* time, which can be
+// wrong for the sink the entry is eventually written to - see
+// effectiveColorMode.
+type marshaledFields []field
+
 type textEncoder struct {
-	bytes       []byte
-	timeFmt     string
-	firstNested bool
+	buf        *buffer.Buffer
+	fields     []field
+	timeFmt    string
+	colorMode  ColorMode
+	forceColor bool
+	resolved   ColorMode
+
+	levelLabels map[zap.Level]string
+	fieldOrder  []string
+	formatters  map[string]func(interface{}) string
+	exclude     map[string]bool
+
+	jsonFallback bool
 }
 
 // NewTextEncoder creates a line-oriented text encoder whose output is optimized
 // for human, rather than machine, consumption. By default, the encoder uses
 // RFC3339-formatted timestamps.
+//
+// Color defaults to ColorAuto: when stdout isn't a terminal (piped to a
+// file, journald, CI logs) no escape bytes are emitted at all. Use
+// TextColorMode or TextForceColor to override the detection.
 func NewColorEncoder(options ...TextOption) zap.Encoder {
 	enc := textPool.Get().(*textEncoder)
 	enc.truncate()
 	enc.timeFmt = time.RFC3339
+	enc.colorMode = ColorAuto
+	enc.forceColor = false
+	enc.levelLabels = nil
+	enc.fieldOrder = nil
+	enc.formatters = nil
+	enc.exclude = nil
+	enc.jsonFallback = false
 	for _, opt := range options {
 		opt.apply(enc)
 	}
+	enc.resolved = resolveColorMode(enc.colorMode, enc.forceColor)
 	return enc
 }
 
 func (enc *textEncoder) Free() {
+	if enc.buf != nil {
+		buffer.Put(enc.buf)
+		enc.buf = nil
+	}
 	textPool.Put(enc)
 }
 
+func (enc *textEncoder) addField(key string, val interface{}) {
+	enc.fields = append(enc.fields, field{key: key, val: val})
+}
+
 func (enc *textEncoder) AddString(key, val string) {
-	enc.addKey(key)
-	enc.bytes = append(enc.bytes, val...)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddBool(key string, val bool) {
-	enc.addKey(key)
-	enc.bytes = strconv.AppendBool(enc.bytes, val)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddInt(key string, val int) {
@@ -57,8 +106,7 @@ func (enc *textEncoder) AddInt(key string, val int) {
 }
 
 func (enc *textEncoder) AddInt64(key string, val int64) {
-	enc.addKey(key)
-	enc.bytes = strconv.AppendInt(enc.bytes, val, 10)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddUint(key string, val uint) {
@@ -66,64 +114,170 @@ func (enc *textEncoder) AddUint(key string, val uint) {
 }
 
 func (enc *textEncoder) AddUint64(key string, val uint64) {
-	enc.addKey(key)
-	enc.bytes = strconv.AppendUint(enc.bytes, val, 10)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddUintptr(key string, val uintptr) {
-	enc.addKey(key)
-	enc.bytes = append(enc.bytes, "0x"...)
-	enc.bytes = strconv.AppendUint(enc.bytes, uint64(val), 16)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddFloat64(key string, val float64) {
-	enc.addKey(key)
-	enc.bytes = strconv.AppendFloat(enc.bytes, val, 'f', -1, 64)
+	enc.addField(key, val)
 }
 
 func (enc *textEncoder) AddMarshaler(key string, obj zap.LogMarshaler) error {
-	enc.addKey(key)
-	enc.firstNested = true
-	enc.bytes = append(enc.bytes, '{')
-	err := obj.MarshalLog(enc)
-	enc.bytes = append(enc.bytes, '}')
-	enc.firstNested = false
+	nested := textPool.Get().(*textEncoder)
+	nested.truncate()
+
+	err := obj.MarshalLog(nested)
+
+	fields := make(marshaledFields, len(nested.fields))
+	copy(fields, nested.fields)
+
+	enc.addField(key, fields)
+	nested.Free()
 	return err
 }
 
 func (enc *textEncoder) AddObject(key string, obj interface{}) error {
-	enc.AddString(key, fmt.Sprintf("%+v", obj))
+	enc.addField(key, fmt.Sprintf("%+v", obj))
 	return nil
 }
 
+// Clone returns an independent copy of enc: clone.fields is a fresh slice
+// (truncate resets the pooled clone to a zero-length slice before the
+// append below, so the append can't grow in place and alias enc's backing
+// array) and clone.buf is its own pooled *buffer.Buffer, never the one enc
+// writes into. This is what makes it safe for a parent logger stored in a
+// context (see WithContext/Ctx) and children derived from it via With() to
+// add fields concurrently without racing on each other's storage.
 func (enc *textEncoder) Clone() zap.Encoder {
 	clone := textPool.Get().(*textEncoder)
 	clone.truncate()
-	clone.bytes = append(clone.bytes, enc.bytes...)
+	clone.fields = append(clone.fields, enc.fields...)
 	clone.timeFmt = enc.timeFmt
-	clone.firstNested = enc.firstNested
+	clone.colorMode = enc.colorMode
+	clone.forceColor = enc.forceColor
+	clone.resolved = enc.resolved
+	clone.levelLabels = enc.levelLabels
+	clone.fieldOrder = enc.fieldOrder
+	clone.formatters = enc.formatters
+	clone.exclude = enc.exclude
+	clone.jsonFallback = enc.jsonFallback
 	return clone
 }
 
+// effectiveColorMode returns the palette WriteEntry should color this call's
+// header/fields with. An explicit, non-ColorAuto mode (set via
+// TextColorMode) is always honored as-is - see resolveColorMode. For
+// ColorAuto without TextForceColor, enc.resolved was computed against
+// os.Stdout at construction time (NewColorEncoder), which can be wrong for
+// the sink this particular WriteEntry call is writing to (a program whose
+// stdout is a terminal but that also logs to a file or NewRotatingSink,
+// say); effectiveColorMode corrects for that by checking the real sink and
+// downgrading to ColorOff when it isn't a terminal.
+func (enc *textEncoder) effectiveColorMode(sink io.Writer) ColorMode {
+	if enc.colorMode != ColorAuto || enc.forceColor {
+		return enc.resolved
+	}
+	if !sinkIsTerminal(sink) {
+		return ColorOff
+	}
+	return enc.resolved
+}
+
+// WriteEntry renders the header (level, time, message) and every field
+// added via the Add* methods into a single line, applying whatever
+// TextFieldOrder/TextPartsExclude/TextFieldFormatter/TextLevelLabels options
+// were configured, then writes it to sink.
 func (enc *textEncoder) WriteEntry(sink io.Writer, msg string, lvl zap.Level, t time.Time) error {
 	if sink == nil {
 		return errors.New("NIL SINK ERR - wut")
 	}
 
+	if enc.jsonFallback && !sinkIsTerminal(sink) {
+		return enc.writeJSONEntry(sink, msg, lvl, t)
+	}
+
+	mode := enc.effectiveColorMode(sink)
+
 	final := textPool.Get().(*textEncoder)
 	final.truncate()
-	enc.addLevel(final, lvl)
-	enc.addTime(final, t)
-	enc.addMessage(final, msg)
 
-	if len(enc.bytes) > 0 {
-		final.bytes = append(final.bytes, ' ')
-		final.bytes = append(final.bytes, enc.bytes...)
+	parts := enc.partOrder()
+	// consumed tracks which enc.fields entries have been emitted, by
+	// index rather than by key: two Add* calls for the same key are two
+	// distinct fields (the baseline encoder emitted both, and callers that
+	// call With()/Add* twice for the same key - a per-request field later
+	// overridden by a per-call one, say - expect both to show up), so
+	// dedup must not collapse them.
+	consumed := make([]bool, len(enc.fields))
+
+	var trailer []byte
+	wrote := false
+	for _, name := range parts {
+		if enc.excluded(name) {
+			if name != "time" && name != "level" && name != "message" && name != "caller" {
+				for i, f := range enc.fields {
+					if !consumed[i] && f.key == name {
+						consumed[i] = true
+					}
+				}
+			}
+			continue
+		}
+		switch name {
+		case "level":
+			wrote = enc.writePart(final, wrote, func() { enc.addLevel(final, lvl, mode) })
+		case "time":
+			if enc.timeFmt == "" {
+				continue
+			}
+			wrote = enc.writePart(final, wrote, func() {
+				final.buf.AppendTime(t, enc.timeFmt)
+			})
+		case "message":
+			if msg == "" {
+				continue
+			}
+			wrote = enc.writePart(final, wrote, func() { enc.addMessage(final, msg) })
+		case "caller":
+			// No caller information is available through this Encoder's
+			// WriteEntry signature, so nothing is rendered here. A field
+			// named "caller" is not placed at this position; it is
+			// emitted with the remaining fields after the ordered parts.
+			continue
+		default:
+			f, idx, ok := enc.nextField(name, consumed)
+			if !ok {
+				continue
+			}
+			consumed[idx] = true
+			wrote = enc.writePart(final, wrote, func() { enc.writeField(final, f, &trailer, mode) })
+		}
+	}
+
+	for i, f := range enc.fields {
+		if consumed[i] {
+			continue
+		}
+		consumed[i] = true
+		// A field excluded via TextPartsExclude must stay excluded even
+		// when its name was never mentioned in partOrder (a custom
+		// TextFieldOrder that omits it, say) - the loop above only ever
+		// sees excluded names that actually appear in parts.
+		if enc.excluded(f.key) {
+			continue
+		}
+		ff := f
+		wrote = enc.writePart(final, wrote, func() { enc.writeField(final, ff, &trailer, mode) })
 	}
-	final.bytes = append(final.bytes, '\n')
 
-	expectedBytes := len(final.bytes)
-	n, err := sink.Write(final.bytes)
+	final.buf.Write(trailer)
+	final.buf.AppendByte('\n')
+
+	expectedBytes := final.buf.Len()
+	n, err := sink.Write(final.buf.Bytes())
 	final.Free()
 	if err != nil {
 		return err
@@ -134,60 +288,292 @@ func (enc *textEncoder) WriteEntry(sink io.Writer, msg string, lvl zap.Level, t
 	return nil
 }
 
-func (enc *textEncoder) truncate() {
-	enc.bytes = enc.bytes[:0]
+// writePart inserts a separating space before everything but the first
+// emitted part, runs fn to append the part itself, and returns whether
+// anything has been written so far.
+func (enc *textEncoder) writePart(final *textEncoder, wrote bool, fn func()) bool {
+	mark := final.buf.Len()
+	if wrote {
+		final.buf.AppendByte(' ')
+	}
+	before := final.buf.Len()
+	fn()
+	if final.buf.Len() == before {
+		final.buf.Truncate(mark)
+		return wrote
+	}
+	return true
+}
+
+// nextField returns the earliest field in enc.fields named key whose index
+// isn't already marked true in consumed, so that repeated calls (one per
+// occurrence of key in partOrder) walk through same-key fields in the
+// order they were added instead of returning the first one every time.
+func (enc *textEncoder) nextField(key string, consumed []bool) (f field, idx int, ok bool) {
+	for i, candidate := range enc.fields {
+		if consumed[i] || candidate.key != key {
+			continue
+		}
+		return candidate, i, true
+	}
+	return field{}, -1, false
+}
+
+// partOrder returns the sequence of part names WriteEntry renders, in
+// order. "level", "time", "message", and "caller" refer to the built-in
+// header parts; everything else names a field.
+func (enc *textEncoder) partOrder() []string {
+	if enc.fieldOrder != nil {
+		return enc.fieldOrder
+	}
+	order := make([]string, 0, 3+len(enc.fields))
+	order = append(order, "level", "time", "message")
+	for _, f := range enc.fields {
+		order = append(order, f.key)
+	}
+	return order
+}
+
+func (enc *textEncoder) excluded(name string) bool {
+	return enc.exclude != nil && enc.exclude[name]
+}
+
+// writeField appends "key=value" to final, coloring the key under mode
+// (see effectiveColorMode). If f is the conventional "error" field and its
+// value spans multiple lines (e.g. a stack trace produced by a %+v-aware
+// error type via AddObject), only the first line is inlined; the remaining
+// lines are indented and appended to *trailer so the caller can place them
+// beneath the finished log line.
+func (enc *textEncoder) writeField(final *textEncoder, f field, trailer *[]byte, mode ColorMode) {
+	appendColoredKey(final.buf, mode, f.key)
+
+	if f.key == "error" {
+		if first, rest, ok := splitErrorStack(f.val, enc.formatters[f.key]); ok {
+			final.buf.AppendString(first)
+			*trailer = append(*trailer, rest...)
+			return
+		}
+	}
+
+	appendFieldValue(final.buf, f.val, enc.formatters[f.key], mode)
+}
+
+// splitErrorStack splits a stringified error field on its first newline,
+// returning the summary line and the remaining lines indented for display
+// beneath the log line. ok is false when the value isn't a multi-line
+// string (the common case), so callers fall back to normal formatting.
+func splitErrorStack(val interface{}, formatter func(interface{}) string) (first string, rest []byte, ok bool) {
+	var s string
+	if p, isPre := val.(prerendered); isPre {
+		s = string(p)
+	} else if formatter != nil {
+		s = formatter(val)
+	} else if str, isStr := val.(string); isStr {
+		s = str
+	} else {
+		return "", nil, false
+	}
+
+	idx := strings.IndexByte(s, '\n')
+	if idx < 0 {
+		return "", nil, false
+	}
+
+	for _, line := range strings.Split(s[idx+1:], "\n") {
+		rest = append(rest, '\n', '\t')
+		rest = append(rest, line...)
+	}
+	return s[:idx], rest, true
+}
+
+func appendFieldValue(buf *buffer.Buffer, val interface{}, formatter func(interface{}) string, mode ColorMode) {
+	if p, isPre := val.(prerendered); isPre {
+		buf.AppendString(string(p))
+		return
+	}
+	if formatter != nil {
+		buf.AppendString(formatter(val))
+		return
+	}
+	switch v := val.(type) {
+	case marshaledFields:
+		appendMarshaledFields(buf, mode, v)
+	case string:
+		buf.AppendString(v)
+	case bool:
+		buf.AppendBool(v)
+	case int64:
+		buf.AppendInt(v)
+	case uint64:
+		buf.AppendUint(v)
+	case uintptr:
+		buf.AppendString("0x")
+		buf.AppendString(strconv.FormatUint(uint64(v), 16))
+	case float64:
+		buf.AppendFloat64(v)
+	default:
+		buf.AppendString(fmt.Sprintf("%+v", v))
+	}
+}
+
+// appendMarshaledFields renders a nested AddMarshaler object's fields
+// inline as "{k=v k=v}", colored under mode. This runs at WriteEntry time
+// (via writeField) rather than when AddMarshaler was called, so the same
+// nested value comes out colored or plain depending on the sink this
+// particular WriteEntry call targets.
+func appendMarshaledFields(buf *buffer.Buffer, mode ColorMode, fields marshaledFields) {
+	buf.AppendByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.AppendByte(' ')
+		}
+		appendColoredKey(buf, mode, f.key)
+		appendFieldValue(buf, f.val, nil, mode)
+	}
+	buf.AppendByte('}')
 }
 
-func (enc *textEncoder) addKey(key string) {
-	lastIdx := len(enc.bytes) - 1
-	if lastIdx >= 0 && !enc.firstNested {
-		enc.bytes = append(enc.bytes, ' ')
+func (enc *textEncoder) truncate() {
+	if enc.buf == nil {
+		enc.buf = buffer.Get()
 	} else {
-		enc.firstNested = false
+		enc.buf.Reset()
+	}
+	enc.fields = enc.fields[:0]
+}
+
+// appendColoredKey writes "key=" under mode directly to buf (no
+// fmt.Sprintf), coloring the key name by hashing it into mode's palette
+// (see appendKeyColorPrefix) so the same key always gets the same color, or
+// writing it plain when mode is ColorOff.
+func appendColoredKey(buf *buffer.Buffer, mode ColorMode, key string) {
+	if mode == ColorOff {
+		buf.AppendString(key)
+		buf.AppendByte('=')
+		return
 	}
-	
+
 	var sum int
 	for _, c := range []byte(key) {
-		sum += int(c)	
+		sum += int(c)
 	}
-	
-	color := (sum % 7) + 1
-	
-	enc.bytes = append(enc.bytes, []byte(fmt.Sprintf("\x1b[3%d;1m%s\x1b[0m", color, key))...)
-	enc.bytes = append(enc.bytes, '=')
+
+	appendKeyColorPrefix(buf, mode, sum)
+	buf.AppendString(key)
+	buf.AppendString("\x1b[0m")
+	buf.AppendByte('=')
 }
 
-func (enc *textEncoder) addLevel(final *textEncoder, lvl zap.Level) {
+// appendKeyColorPrefix writes the SGR escape that opens a key's color,
+// picked by hashing the key into the palette available under mode:
+// ColorANSI16 and ColorTrueColor choose among 7 colors (sum % 7),
+// ColorANSI256 among 36 cells (160-195, sum % 36). A given key always gets
+// the same color within one palette; its color is not kept the same across
+// palettes.
+func appendKeyColorPrefix(buf *buffer.Buffer, mode ColorMode, sum int) {
+	switch mode {
+	case ColorANSI256:
+		idx := 160 + (sum % 36) // a band of saturated 256-color cells
+		buf.AppendString("\x1b[38;5;")
+		buf.AppendInt(int64(idx))
+		buf.AppendString(";1m")
+	case ColorTrueColor:
+		hues := [7][3]int{
+			{220, 50, 47}, {38, 139, 210}, {133, 153, 0},
+			{181, 137, 0}, {211, 54, 130}, {42, 161, 152}, {108, 113, 196},
+		}
+		rgb := hues[sum%len(hues)]
+		buf.AppendString("\x1b[38;2;")
+		buf.AppendInt(int64(rgb[0]))
+		buf.AppendByte(';')
+		buf.AppendInt(int64(rgb[1]))
+		buf.AppendByte(';')
+		buf.AppendInt(int64(rgb[2]))
+		buf.AppendString(";1m")
+	default: // ColorANSI16
+		color := (sum % 7) + 1
+		buf.AppendString("\x1b[3")
+		buf.AppendInt(int64(color))
+		buf.AppendString(";1m")
+	}
+}
+
+func (enc *textEncoder) addLevel(final *textEncoder, lvl zap.Level, mode ColorMode) {
+	if label, ok := enc.levelLabels[lvl]; ok {
+		if mode == ColorOff {
+			final.buf.AppendString(label)
+		} else {
+			final.buf.AppendString(levelColorPrefix(lvl))
+			final.buf.AppendString(label)
+			final.buf.AppendString("\x1b[0m")
+		}
+		return
+	}
+
+	if mode == ColorOff {
+		final.buf.AppendByte('[')
+		final.buf.AppendString(levelLabel(lvl))
+		final.buf.AppendByte(']')
+		return
+	}
+
 	switch lvl {
 	case zap.DebugLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[32;1m[DEBG]\x1b[0m")...)
+		final.buf.AppendString("\x1b[32;1m[DEBG]\x1b[0m")
 	case zap.InfoLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[34;1m[INFO]\x1b[0m")...)
+		final.buf.AppendString("\x1b[34;1m[INFO]\x1b[0m")
 	case zap.WarnLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[33;1m[WARN]\x1b[0m")...)
+		final.buf.AppendString("\x1b[33;1m[WARN]\x1b[0m")
 	case zap.ErrorLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[31;1m[ERRO]\x1b[0m")...)
+		final.buf.AppendString("\x1b[31;1m[ERRO]\x1b[0m")
 	case zap.PanicLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[31;1m[PANC]\x1b[0m")...)
+		final.buf.AppendString("\x1b[31;1m[PANC]\x1b[0m")
 	case zap.FatalLevel:
-		final.bytes = append(final.bytes, []byte("\x1b[31;1m[FATA]\x1b[0m")...)
+		final.buf.AppendString("\x1b[31;1m[FATA]\x1b[0m")
 	default:
-		final.bytes = strconv.AppendInt(final.bytes, int64(lvl), 10)
+		final.buf.AppendInt(int64(lvl))
 	}
 }
 
-func (enc *textEncoder) addTime(final *textEncoder, t time.Time) {
-	if enc.timeFmt == "" {
-		return
+func levelColorPrefix(lvl zap.Level) string {
+	switch lvl {
+	case zap.DebugLevel:
+		return "\x1b[32;1m"
+	case zap.InfoLevel:
+		return "\x1b[34;1m"
+	case zap.WarnLevel:
+		return "\x1b[33;1m"
+	default:
+		return "\x1b[31;1m"
+	}
+}
+
+func levelLabel(lvl zap.Level) string {
+	switch lvl {
+	case zap.DebugLevel:
+		return "DEBG"
+	case zap.InfoLevel:
+		return "INFO"
+	case zap.WarnLevel:
+		return "WARN"
+	case zap.ErrorLevel:
+		return "ERRO"
+	case zap.PanicLevel:
+		return "PANC"
+	case zap.FatalLevel:
+		return "FATA"
+	default:
+		return strconv.FormatInt(int64(lvl), 10)
 	}
-	final.bytes = append(final.bytes, ' ')
-	final.bytes = t.AppendFormat(final.bytes, enc.timeFmt)
 }
 
+// addMessage left-aligns msg in a fixed 25-column field, appending the
+// trailing spaces byte by byte rather than through fmt.Sprintf("%-25s", msg),
+// so printing a message doesn't allocate.
 func (enc *textEncoder) addMessage(final *textEncoder, msg string) {
-	if msg != "" {
-		final.bytes = append(final.bytes, ' ')
-		final.bytes = append(final.bytes, []byte(fmt.Sprintf("%-25s", msg))...)
+	final.buf.AppendString(msg)
+	for i := len(msg); i < 25; i++ {
+		final.buf.AppendByte(' ')
 	}
 }
 
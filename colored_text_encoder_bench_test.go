@@ -0,0 +1,69 @@
+package zapcolors
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/uber-go/zap"
+)
+
+type benchMarshaler struct{}
+
+func (benchMarshaler) MarshalLog(kv zap.KeyValue) error {
+	kv.AddString("nested_key", "nested_value")
+	kv.AddInt("nested_count", 3)
+	return nil
+}
+
+func BenchmarkTextEncoder_AddString(b *testing.B) {
+	enc := NewColorEncoder(TextForceColor(true)).(*textEncoder)
+	defer enc.Free()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// Reset enc.fields every iteration so the benchmark measures one
+		// AddString call's steady-state cost, not an ever-growing slice
+		// (b.N commonly runs into the hundreds of millions).
+		enc.truncate()
+		enc.AddString("key", "value")
+	}
+}
+
+func BenchmarkTextEncoder_AddInt64(b *testing.B) {
+	enc := NewColorEncoder(TextForceColor(true)).(*textEncoder)
+	defer enc.Free()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc.truncate()
+		enc.AddInt64("key", int64(i))
+	}
+}
+
+func BenchmarkTextEncoder_AddMarshaler(b *testing.B) {
+	enc := NewColorEncoder(TextForceColor(true)).(*textEncoder)
+	defer enc.Free()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc.truncate()
+		enc.AddMarshaler("obj", benchMarshaler{})
+	}
+}
+
+func BenchmarkTextEncoder_WriteEntry(b *testing.B) {
+	now := time.Now()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// Get a pooled encoder and Free it back every iteration so this
+		// measures the pooled hot path chunk0-3 introduced, not a fresh
+		// allocation per entry.
+		enc := NewColorEncoder(TextForceColor(true)).(*textEncoder)
+		enc.AddString("key", "value")
+		enc.AddInt64("count", int64(i))
+		enc.WriteEntry(ioutil.Discard, "benchmark message", zap.InfoLevel, now)
+		enc.Free()
+	}
+}
@@ -0,0 +1,168 @@
+package zapcolors
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/uber-go/zap"
+)
+
+// TestClone_FieldIndependence guards the invariant Clone documents: adding
+// fields to a clone must not affect the parent it was cloned from, and vice
+// versa, since both are expected to be mutated concurrently once a parent
+// logger is shared through a context (see WithContext/Ctx).
+func TestClone_FieldIndependence(t *testing.T) {
+	parent := NewColorEncoder(TextForceColor(false)).(*textEncoder)
+	defer parent.Free()
+	parent.AddString("shared", "parent-value")
+
+	child := parent.Clone().(*textEncoder)
+	defer child.Free()
+
+	child.AddString("child_only", "child-value")
+	parent.AddString("parent_only", "parent-value-2")
+
+	if got := len(parent.fields); got != 2 {
+		t.Fatalf("parent.fields: got %d fields, want 2 (%+v)", got, parent.fields)
+	}
+	if got := len(child.fields); got != 2 {
+		t.Fatalf("child.fields: got %d fields, want 2 (%+v)", got, child.fields)
+	}
+
+	for _, f := range parent.fields {
+		if f.key == "child_only" {
+			t.Fatalf("parent.fields leaked child's field: %+v", parent.fields)
+		}
+	}
+	for _, f := range child.fields {
+		if f.key == "parent_only" {
+			t.Fatalf("child.fields leaked parent's field: %+v", child.fields)
+		}
+	}
+}
+
+// TestWriteEntry_DuplicateKeysBothEmitted guards against WriteEntry
+// collapsing two Add* calls for the same key into one rendered field (a
+// regression from the baseline encoder, which appended raw bytes for every
+// field regardless of key collisions). A caller adding a per-request field
+// that's later overridden by a per-call field of the same name expects both
+// to show up, not just the first.
+func TestWriteEntry_DuplicateKeysBothEmitted(t *testing.T) {
+	enc := NewColorEncoder(TextColorMode(ColorOff), TextNoTime()).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("a", "1")
+	enc.AddString("a", "2")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	got := buf.String()
+	if !bytes.Contains(buf.Bytes(), []byte("a=1")) || !bytes.Contains(buf.Bytes(), []byte("a=2")) {
+		t.Fatalf("WriteEntry output missing one of the duplicate-key values: %q", got)
+	}
+}
+
+// TestWriteEntry_MarshaledFieldsColoredAtWriteTime guards against AddMarshaler
+// baking colored bytes into a nested field at Add* time using whatever
+// enc.resolved happened to be at construction: it must be re-colored (or
+// left plain) per effectiveColorMode's verdict for the actual sink passed to
+// WriteEntry, same as every other field.
+func TestWriteEntry_MarshaledFieldsColoredAtWriteTime(t *testing.T) {
+	enc := NewColorEncoder(TextColorMode(ColorAuto), TextNoTime()).(*textEncoder)
+	defer enc.Free()
+	// Simulate stdout having been a terminal at construction time.
+	enc.resolved = ColorANSI16
+
+	if err := enc.AddMarshaler("obj", benchMarshaler{}); err != nil {
+		t.Fatalf("AddMarshaler: %v", err)
+	}
+
+	var buf bytes.Buffer // not a terminal
+	if err := enc.WriteEntry(&buf, "", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	if bytes.ContainsRune(buf.Bytes(), '\x1b') {
+		t.Fatalf("WriteEntry to a non-terminal sink emitted ANSI escapes for a marshaled field: %q", buf.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("obj={nested_key=nested_value nested_count=3}")) {
+		t.Fatalf("WriteEntry output missing expected plain marshaled field: %q", buf.String())
+	}
+}
+
+// TestWriteEntry_FieldOrderAndExclude exercises TextFieldOrder (including a
+// field not named in the order, which must be appended afterward) and
+// TextPartsExclude together.
+func TestWriteEntry_FieldOrderAndExclude(t *testing.T) {
+	enc := NewColorEncoder(
+		TextColorMode(ColorOff),
+		TextNoTime(),
+		TextFieldOrder([]string{"message", "level", "b"}),
+		TextPartsExclude([]string{"c"}),
+	).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("b", "B")
+	enc.AddString("a", "A")
+	enc.AddString("c", "C")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "msg", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := "msg                       [INFO] b=B a=A\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
+
+// TestWriteEntry_FieldFormatter checks that TextFieldFormatter overrides
+// the default stringification for the key it's registered against, and
+// leaves other fields alone.
+func TestWriteEntry_FieldFormatter(t *testing.T) {
+	enc := NewColorEncoder(
+		TextColorMode(ColorOff),
+		TextNoTime(),
+		TextFieldFormatter("n", func(v interface{}) string { return "<redacted>" }),
+	).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddInt64("n", 42)
+	enc.AddString("plain", "value")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := "[INFO] n=<redacted> plain=value\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
+
+// TestWriteEntry_ErrorStackTrailer checks that a multi-line "error" field
+// is split: the first line inlines with the rest of the fields, and the
+// remaining lines are indented and appended after everything else.
+func TestWriteEntry_ErrorStackTrailer(t *testing.T) {
+	enc := NewColorEncoder(TextColorMode(ColorOff), TextNoTime()).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("error", "boom\ngithub.com/x/y.Do\n\t/src/y.go:10")
+	enc.AddString("after", "still-here")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := "[INFO] error=boom after=still-here\n\tgithub.com/x/y.Do\n\t\t/src/y.go:10\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
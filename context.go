@@ -0,0 +1,55 @@
+package zapcolors
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/uber-go/zap"
+)
+
+// ctxKey is an unexported type so WithContext/Ctx own their context key and
+// can't collide with keys set by other packages.
+type ctxKey struct{}
+
+// WithContext returns a copy of ctx carrying logger, retrievable with Ctx.
+// If ctx already carries this exact logger, ctx is returned unchanged
+// rather than allocating a new one, since a common pattern is re-attaching
+// the same logger to a context on every request in a hot path (e.g.
+// middleware that calls WithContext unconditionally).
+func WithContext(ctx context.Context, logger zap.Logger) context.Context {
+	if existing, ok := ctx.Value(ctxKey{}).(zap.Logger); ok && sameLogger(existing, logger) {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// sameLogger reports whether existing and logger are the same value, so
+// WithContext can skip re-storing a logger that's already there.
+// zap.Logger is an interface whose concrete type WithContext doesn't
+// control: a caller could pass a value-typed implementation holding a
+// slice, map, or func field, and comparing two such values with ==
+// panics at runtime ("comparing uncomparable type ..."). Guard with
+// reflect and treat a nil or uncomparable logger as always different -
+// that costs at most one extra context.WithValue call, never incorrect
+// behavior.
+func sameLogger(existing, logger zap.Logger) bool {
+	if logger == nil {
+		return existing == nil
+	}
+	if !reflect.TypeOf(logger).Comparable() {
+		return false
+	}
+	return existing == logger
+}
+
+// Ctx returns the logger stored in ctx by WithContext, or zap.NewNOP() if
+// none was stored. Fields added via the returned logger's With() land on a
+// clone (see textEncoder.Clone) and never mutate the logger stored in ctx,
+// so concurrent goroutines that each call Ctx(ctx).With(...) on the same
+// context are safe to run without synchronization between them.
+func Ctx(ctx context.Context) zap.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(zap.Logger); ok {
+		return logger
+	}
+	return zap.NewNOP()
+}
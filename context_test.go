@@ -0,0 +1,73 @@
+package zapcolors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/uber-go/zap"
+)
+
+// sliceLogger is a zap.Logger implementation whose underlying type isn't
+// comparable with ==, mirroring what a test double or value-typed wrapper
+// around a real logger might look like.
+type sliceLogger struct {
+	tags []string
+}
+
+func (sliceLogger) Log(zap.Level, string) {}
+
+// TestCtx_EmptyContextReturnsNOP checks that Ctx falls back to a NOP logger
+// when ctx carries nothing under zapcolors' key.
+func TestCtx_EmptyContextReturnsNOP(t *testing.T) {
+	if got := Ctx(context.Background()); got != zap.NewNOP() {
+		t.Fatalf("Ctx(empty context) = %#v, want zap.NewNOP()", got)
+	}
+}
+
+// TestWithContext_RoundTrip checks that a logger stored via WithContext is
+// retrievable unchanged via Ctx.
+func TestWithContext_RoundTrip(t *testing.T) {
+	enc := NewColorEncoder(TextColorMode(ColorOff)).(*textEncoder)
+	defer enc.Free()
+
+	ctx := WithContext(context.Background(), sliceLogger{tags: []string{"a"}})
+	got, ok := Ctx(ctx).(sliceLogger)
+	if !ok {
+		t.Fatalf("Ctx(ctx) = %#v, want a sliceLogger", Ctx(ctx))
+	}
+	if len(got.tags) != 1 || got.tags[0] != "a" {
+		t.Fatalf("Ctx(ctx) = %+v, want tags [a]", got)
+	}
+}
+
+// TestWithContext_SamePointerIsNoOp checks that re-attaching the exact same
+// logger value returns ctx unchanged rather than allocating a new one.
+func TestWithContext_SamePointerIsNoOp(t *testing.T) {
+	logger := zap.NewNOP()
+	ctx := WithContext(context.Background(), logger)
+
+	again := WithContext(ctx, logger)
+	if again != ctx {
+		t.Fatalf("WithContext with the same logger returned a different context, want the same one back")
+	}
+}
+
+// TestWithContext_UncomparableLoggerDoesNotPanic guards against the ==
+// comparison WithContext used to do directly on zap.Logger interface
+// values: a value-typed implementation containing a slice field panics on
+// == when the dynamic types match ("comparing uncomparable type
+// zapcolors.sliceLogger"). WithContext must treat two such values as
+// different (always replace) instead of panicking.
+func TestWithContext_UncomparableLoggerDoesNotPanic(t *testing.T) {
+	ctx := WithContext(context.Background(), sliceLogger{tags: []string{"a"}})
+
+	ctx = WithContext(ctx, sliceLogger{tags: []string{"b"}})
+
+	got, ok := Ctx(ctx).(sliceLogger)
+	if !ok {
+		t.Fatalf("Ctx(ctx) = %#v, want a sliceLogger", Ctx(ctx))
+	}
+	if len(got.tags) != 1 || got.tags[0] != "b" {
+		t.Fatalf("Ctx(ctx) = %+v, want the second WithContext call's logger (tags [b])", got)
+	}
+}
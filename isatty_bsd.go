@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package zapcolors
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TIOCGETA
@@ -0,0 +1,8 @@
+//go:build linux
+// +build linux
+
+package zapcolors
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
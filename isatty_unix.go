@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package zapcolors
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether fd is attached to a terminal, modeled after
+// mattn/go-isatty's ioctl-based probe.
+func isTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+	return errno == 0
+}
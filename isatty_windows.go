@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package zapcolors
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+)
+
+// isTerminal reports whether fd is attached to a console, modeled after
+// mattn/go-isatty's GetConsoleMode-based probe.
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	r, _, _ := procGetConsoleMode.Call(fd, uintptr(unsafe.Pointer(&mode)))
+	return r != 0
+}
@@ -0,0 +1,225 @@
+// Package rotate provides a lumberjack-style rotating file writer that can
+// be plugged in anywhere an io.Writer is accepted, e.g. as the sink passed
+// to zap.Output for a logger built on zapcolors.NewColorEncoder.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions configures size- and time-based rotation for a sink created
+// by NewRotatingSink, mirroring the knobs natefinch/lumberjack exposes.
+type RotateOptions struct {
+	// MaxSize is the size in megabytes a log file is allowed to reach
+	// before it's rotated. Zero disables size-based rotation.
+	MaxSize int
+	// MaxAge is the maximum number of days to retain old log files, based
+	// on their modification time. Zero disables age-based
+	// cleanup.
+	MaxAge int
+	// MaxBackups is the maximum number of old log files to retain. Zero
+	// means retain all of them (subject to MaxAge).
+	MaxBackups int
+	// Compress gzip-compresses rotated files once they're no longer being
+	// written to.
+	Compress bool
+}
+
+// rotatingSink is an io.Writer that appends to a file at path, rotating it
+// out to a timestamped backup once it exceeds opts.MaxSize megabytes, and
+// pruning old backups per opts.MaxBackups/MaxAge.
+type rotatingSink struct {
+	mu   sync.Mutex
+	path string
+	opts RotateOptions
+
+	file *os.File
+	size int64
+}
+
+// NewRotatingSink returns an io.Writer that appends to path, rotating the
+// file when it exceeds opts.MaxSize megabytes and pruning old backups per
+// opts.MaxBackups and opts.MaxAge. It's safe for concurrent use by multiple
+// goroutines, as required of a zap.Output sink.
+func NewRotatingSink(path string, opts RotateOptions) io.Writer {
+	return &rotatingSink{path: path, opts: opts}
+}
+
+// Write implements io.Writer, rotating the underlying file first if this
+// write would push it past opts.MaxSize.
+func (s *rotatingSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.openExisting(); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.opts.MaxSize > 0 && s.size+int64(len(p)) > int64(s.opts.MaxSize)*1024*1024 {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// openExisting opens path for appending, creating it (and its parent
+// directory) if necessary, and picks up the size of whatever's already
+// there so rotation decisions survive process restarts.
+func (s *rotatingSink) openExisting() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("rotate: create log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("rotate: open log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("rotate: stat log file: %w", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate closes the current file, renames it aside with a timestamp
+// suffix, optionally compresses it, opens a fresh file at path, and prunes
+// old backups.
+func (s *rotatingSink) rotate() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("rotate: close log file: %w", err)
+		}
+		s.file = nil
+	}
+
+	backup := backupName(s.path, time.Now())
+	if err := os.Rename(s.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate: rename log file: %w", err)
+	}
+
+	if s.opts.Compress {
+		if err := compressFile(backup); err != nil {
+			return fmt.Errorf("rotate: compress backup: %w", err)
+		}
+	}
+
+	if err := s.openExisting(); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+// backupName derives the rotated filename for path, inserting a
+// sortable timestamp before the extension, e.g. "app.log" rotated at
+// 2026-07-29T10:15:00Z becomes "app-2026-07-29T10-15-00.log".
+func backupName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	stamp := t.UTC().Format("2006-01-02T15-04-05")
+	return fmt.Sprintf("%s-%s%s", base, stamp, ext)
+}
+
+// compressFile gzips path in place, replacing it with a ".gz" sibling.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// prune removes rotated backups of path beyond opts.MaxBackups and older
+// than opts.MaxAge days, oldest first.
+func (s *rotatingSink) prune() error {
+	if s.opts.MaxBackups <= 0 && s.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	dir := filepath.Dir(s.path)
+	ext := filepath.Ext(s.path)
+	base := strings.TrimSuffix(filepath.Base(s.path), ext)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("rotate: list log directory: %w", err)
+	}
+
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if name == filepath.Base(s.path) {
+			continue
+		}
+		if !strings.HasPrefix(name, base+"-") {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	sort.Strings(backups) // the timestamp prefix sorts lexically == chronologically
+
+	if s.opts.MaxAge > 0 {
+		cutoff := time.Now().Add(-time.Duration(s.opts.MaxAge) * 24 * time.Hour)
+		kept := backups[:0]
+		for _, b := range backups {
+			info, err := os.Stat(b)
+			if err != nil || info.ModTime().Before(cutoff) {
+				os.Remove(b)
+				continue
+			}
+			kept = append(kept, b)
+		}
+		backups = kept
+	}
+
+	if s.opts.MaxBackups > 0 && len(backups) > s.opts.MaxBackups {
+		for _, b := range backups[:len(backups)-s.opts.MaxBackups] {
+			os.Remove(b)
+		}
+	}
+
+	return nil
+}
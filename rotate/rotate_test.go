@@ -0,0 +1,217 @@
+package rotate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNewRotatingSink_SizeRotation checks that a write which would push the
+// file past MaxSize rotates it out first, leaving the new file with just
+// the write that triggered rotation.
+func TestNewRotatingSink_SizeRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	sink := NewRotatingSink(path, RotateOptions{MaxSize: 1}) // 1MB
+	rs := sink.(*rotatingSink)
+
+	big := bytes.Repeat([]byte("a"), 1024*1024)
+	if _, err := sink.Write(big); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// This write would push the file past 1MB, so it must rotate first.
+	if _, err := sink.Write([]byte("b")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	rs.mu.Lock()
+	size := rs.size
+	rs.mu.Unlock()
+	if size != 1 {
+		t.Fatalf("current file size = %d, want 1 (rotation should have reset it)", size)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d files in log dir, want 2 (current + 1 backup): %v", len(entries), entries)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "b" {
+		t.Fatalf("current log file contents = %q, want %q", got, "b")
+	}
+}
+
+// TestNewRotatingSink_Compress checks that Compress gzips the rotated
+// backup and removes the uncompressed copy.
+func TestNewRotatingSink_Compress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	sink := NewRotatingSink(path, RotateOptions{MaxSize: 1, Compress: true})
+
+	big := bytes.Repeat([]byte("a"), 1024*1024)
+	if _, err := sink.Write(big); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := sink.Write([]byte("b")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	var gz string
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".gz" {
+			gz = filepath.Join(dir, e.Name())
+		}
+		if filepath.Base(e.Name()) != "app.log" && filepath.Ext(e.Name()) == ".log" {
+			t.Fatalf("found uncompressed backup %q, want it removed after compression", e.Name())
+		}
+	}
+	if gz == "" {
+		t.Fatalf("no .gz backup found in %v", entries)
+	}
+
+	f, err := os.Open(gz)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Fatalf("decompressed backup contents don't match original write (got %d bytes, want %d)", len(got), len(big))
+	}
+}
+
+// TestRotatingSink_PruneMaxBackups checks that prune keeps only the newest
+// MaxBackups backups, oldest first, regardless of MaxAge.
+func TestRotatingSink_PruneMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	if err := os.WriteFile(path, []byte("current"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var names []string
+	for i := 0; i < 5; i++ {
+		name := backupName(path, base.Add(time.Duration(i)*time.Hour))
+		if err := os.WriteFile(name, []byte("backup"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	s := &rotatingSink{path: path, opts: RotateOptions{MaxBackups: 2}}
+	if err := s.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	for i, name := range names {
+		_, err := os.Stat(name)
+		wantRemoved := i < 3
+		if wantRemoved && !os.IsNotExist(err) {
+			t.Errorf("backup %d (%s) still exists, want pruned", i, name)
+		}
+		if !wantRemoved && err != nil {
+			t.Errorf("backup %d (%s) was removed, want kept: %v", i, name, err)
+		}
+	}
+}
+
+// TestRotatingSink_PruneMaxAge checks that prune removes backups whose
+// modtime is older than MaxAge days and keeps the rest.
+func TestRotatingSink_PruneMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	if err := os.WriteFile(path, []byte("current"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	oldName := backupName(path, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	newName := backupName(path, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	for _, name := range []string{oldName, newName} {
+		if err := os.WriteFile(name, []byte("backup"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	old := time.Now().Add(-365 * 24 * time.Hour)
+	if err := os.Chtimes(oldName, old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	s := &rotatingSink{path: path, opts: RotateOptions{MaxAge: 1}}
+	if err := s.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	if _, err := os.Stat(oldName); !os.IsNotExist(err) {
+		t.Errorf("old backup %s still exists, want pruned by MaxAge", oldName)
+	}
+	if _, err := os.Stat(newName); err != nil {
+		t.Errorf("recent backup %s was removed, want kept: %v", newName, err)
+	}
+}
+
+// TestBackupName checks the timestamp suffix is inserted before the
+// extension, sorting lexically in chronological order.
+func TestBackupName(t *testing.T) {
+	got := backupName("/var/log/app.log", time.Date(2026, 7, 29, 10, 15, 0, 0, time.UTC))
+	want := "/var/log/app-2026-07-29T10-15-00.log"
+	if got != want {
+		t.Fatalf("backupName = %q, want %q", got, want)
+	}
+}
+
+// TestNewRotatingSink_AppendsAcrossRestarts checks that a sink opened
+// against a path with existing content picks up its size instead of
+// clobbering it, so rotation decisions survive process restarts.
+func TestNewRotatingSink_AppendsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	if err := os.WriteFile(path, []byte("existing"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	sink := NewRotatingSink(path, RotateOptions{MaxSize: 1})
+	if _, err := sink.Write([]byte("-more")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "existing-more" {
+		t.Fatalf("log file contents = %q, want %q", got, "existing-more")
+	}
+}
@@ -0,0 +1,258 @@
+package zapcolors
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aarondl/zapcolors/buffer"
+	"github.com/uber-go/zap"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// TextFallbackJSON enables a fallback mode where WriteEntry emits a compact
+// JSON object (`{"level":"info","ts":"...","msg":"...",<fields>}`) instead
+// of an ANSI-decorated line, whenever the destination io.Writer isn't
+// detected as a terminal (piped to a file, a log aggregator, and so on).
+// This lets a single encoder serve both interactive dev consoles and
+// production file/aggregator sinks. TextFieldOrder and TextPartsExclude
+// still apply to the JSON output, and a TextLevelLabels override replaces
+// the "level" value; TextFieldFormatter does not apply.
+func TextFallbackJSON(enabled bool) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		enc.jsonFallback = enabled
+	})
+}
+
+// sinkIsTerminal reports whether sink is attached to a terminal. Sinks that
+// don't expose a file descriptor at all (a bytes.Buffer, a network
+// connection) are treated as non-terminal, which is the common case for
+// anything other than os.Stdout/os.Stderr.
+func sinkIsTerminal(sink io.Writer) bool {
+	f, ok := sink.(interface{ Fd() uintptr })
+	if !ok {
+		return false
+	}
+	return isTerminal(f.Fd())
+}
+
+// writeJSONEntry renders the entry as a single compact JSON object, walking
+// the same part order/exclusion logic as WriteEntry's text path. Unlike the
+// text path, a key is only ever emitted once here: a JSON object with two
+// "a" keys is syntactically legal but every conformant decoder (including
+// encoding/json) silently keeps only the last one and drops the rest on
+// parse, so letting both through would just move the data loss from inside
+// zapcolors to inside whatever reads the JSON. The last Add* call for a key
+// wins, matching what a consumer actually observes.
+func (enc *textEncoder) writeJSONEntry(sink io.Writer, msg string, lvl zap.Level, t time.Time) error {
+	final := textPool.Get().(*textEncoder)
+	final.truncate()
+
+	parts := enc.partOrder()
+	// lastIndex maps each field key to the index of its last occurrence in
+	// enc.fields, so repeated Add* calls for the same key collapse to the
+	// most recent value instead of appearing as duplicate JSON keys.
+	lastIndex := make(map[string]int, len(enc.fields))
+	for i, f := range enc.fields {
+		lastIndex[f.key] = i
+	}
+	// emitted tracks which keys have already been written (or excluded),
+	// by key rather than by index, since duplicates now collapse to one.
+	emitted := make(map[string]bool, len(enc.fields))
+
+	final.buf.AppendByte('{')
+	wrote := false
+	for _, name := range parts {
+		if enc.excluded(name) {
+			if name != "time" && name != "level" && name != "message" && name != "caller" {
+				emitted[name] = true
+			}
+			continue
+		}
+		switch name {
+		case "level":
+			wrote = enc.writeJSONPart(final, wrote, "level", func() {
+				appendJSONString(final.buf, enc.jsonLevelLabel(lvl))
+			})
+		case "time":
+			if enc.timeFmt == "" {
+				continue
+			}
+			wrote = enc.writeJSONPart(final, wrote, "ts", func() {
+				final.buf.AppendByte('"')
+				final.buf.AppendTime(t, enc.timeFmt)
+				final.buf.AppendByte('"')
+			})
+		case "message":
+			if msg == "" {
+				continue
+			}
+			wrote = enc.writeJSONPart(final, wrote, "msg", func() { appendJSONString(final.buf, msg) })
+		case "caller":
+			// See the matching case in WriteEntry: no caller information
+			// reaches this encoder.
+			continue
+		default:
+			idx, ok := lastIndex[name]
+			if !ok || emitted[name] {
+				continue
+			}
+			emitted[name] = true
+			f := enc.fields[idx]
+			wrote = enc.writeJSONPart(final, wrote, f.key, func() { appendJSONValue(final.buf, f.val) })
+		}
+	}
+
+	for i, f := range enc.fields {
+		if i != lastIndex[f.key] || emitted[f.key] {
+			continue
+		}
+		emitted[f.key] = true
+		if enc.excluded(f.key) {
+			continue
+		}
+		ff := f
+		wrote = enc.writeJSONPart(final, wrote, ff.key, func() { appendJSONValue(final.buf, ff.val) })
+	}
+
+	final.buf.AppendByte('}')
+	final.buf.AppendByte('\n')
+
+	expectedBytes := final.buf.Len()
+	n, err := sink.Write(final.buf.Bytes())
+	final.Free()
+	if err != nil {
+		return err
+	}
+	if n != expectedBytes {
+		return fmt.Errorf("incomplete write: only wrote %v of %v bytes", n, expectedBytes)
+	}
+	return nil
+}
+
+// writeJSONPart writes `"key":value` to final, preceded by a comma if wrote
+// is true, and rolls the whole thing back if fn didn't append anything
+// (e.g. an excluded or empty part).
+func (enc *textEncoder) writeJSONPart(final *textEncoder, wrote bool, key string, fn func()) bool {
+	mark := final.buf.Len()
+	if wrote {
+		final.buf.AppendByte(',')
+	}
+	appendJSONString(final.buf, key)
+	final.buf.AppendByte(':')
+	before := final.buf.Len()
+	fn()
+	if final.buf.Len() == before {
+		final.buf.Truncate(mark)
+		return wrote
+	}
+	return true
+}
+
+// jsonLevelLabel returns the label to use for lvl in JSON output: the
+// user-configured TextLevelLabels override if one was registered, or the
+// lowercase level name otherwise (matching the field name zap's own JSON
+// encoder uses).
+func (enc *textEncoder) jsonLevelLabel(lvl zap.Level) string {
+	if label, ok := enc.levelLabels[lvl]; ok {
+		return label
+	}
+	switch lvl {
+	case zap.DebugLevel:
+		return "debug"
+	case zap.InfoLevel:
+		return "info"
+	case zap.WarnLevel:
+		return "warn"
+	case zap.ErrorLevel:
+		return "error"
+	case zap.PanicLevel:
+		return "panic"
+	case zap.FatalLevel:
+		return "fatal"
+	default:
+		return levelLabel(lvl)
+	}
+}
+
+// appendJSONValue appends val's JSON representation, handling the same
+// boxed value types addField stores (string, bool, int64, uint64, uintptr,
+// float64, marshaledFields, or prerendered).
+func appendJSONValue(buf *buffer.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case prerendered:
+		appendJSONString(buf, string(v))
+	case marshaledFields:
+		appendJSONMarshaledFields(buf, v)
+	case string:
+		appendJSONString(buf, v)
+	case bool:
+		buf.AppendBool(v)
+	case int64:
+		buf.AppendInt(v)
+	case uint64:
+		buf.AppendUint(v)
+	case uintptr:
+		buf.AppendString(`"0x`)
+		buf.AppendString(strconv.FormatUint(uint64(v), 16))
+		buf.AppendByte('"')
+	case float64:
+		buf.AppendFloat64(v)
+	default:
+		appendJSONString(buf, fmt.Sprintf("%+v", v))
+	}
+}
+
+// appendJSONMarshaledFields renders a nested AddMarshaler object's fields as
+// a JSON object, mirroring appendMarshaledFields's text-mode rendering.
+func appendJSONMarshaledFields(buf *buffer.Buffer, fields marshaledFields) {
+	buf.AppendByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.AppendByte(',')
+		}
+		appendJSONString(buf, f.key)
+		buf.AppendByte(':')
+		appendJSONValue(buf, f.val)
+	}
+	buf.AppendByte('}')
+}
+
+// appendJSONString appends s as a quoted, escaped JSON string, copying
+// unescaped runs verbatim rather than going through a per-rune formatter.
+func appendJSONString(buf *buffer.Buffer, s string) {
+	buf.AppendByte('"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
+		}
+		if start < i {
+			buf.AppendString(s[start:i])
+		}
+		switch c {
+		case '"':
+			buf.AppendString(`\"`)
+		case '\\':
+			buf.AppendString(`\\`)
+		case '\n':
+			buf.AppendString(`\n`)
+		case '\t':
+			buf.AppendString(`\t`)
+		case '\r':
+			buf.AppendString(`\r`)
+		default:
+			buf.AppendString(`\u00`)
+			buf.AppendByte(hexDigits[c>>4])
+			buf.AppendByte(hexDigits[c&0xf])
+		}
+		start = i + 1
+	}
+	if start < len(s) {
+		buf.AppendString(s[start:])
+	}
+	buf.AppendByte('"')
+}
@@ -0,0 +1,116 @@
+package zapcolors
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aarondl/zapcolors/buffer"
+	"github.com/uber-go/zap"
+)
+
+// TestWriteEntry_JSONFallbackOnNonTerminalSink checks that TextFallbackJSON
+// switches WriteEntry's output to the compact JSON form whenever the sink
+// isn't a terminal (here, a bytes.Buffer, which never implements Fd()).
+func TestWriteEntry_JSONFallbackOnNonTerminalSink(t *testing.T) {
+	enc := NewColorEncoder(
+		TextForceColor(true),
+		TextFallbackJSON(true),
+		TextNoTime(),
+	).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("a", "1")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "msg", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := `{"level":"info","msg":"msg","a":"1"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
+
+// TestWriteEntry_JSONDuplicateKeysLastWins checks that two Add* calls for
+// the same key collapse to a single JSON key holding the last value,
+// rather than rendering as two duplicate JSON keys: a conformant decoder
+// (including encoding/json) would silently keep only the last one anyway,
+// so emitting both would just hide the data loss one level down instead of
+// fixing it.
+func TestWriteEntry_JSONDuplicateKeysLastWins(t *testing.T) {
+	enc := NewColorEncoder(
+		TextForceColor(true),
+		TextFallbackJSON(true),
+		TextNoTime(),
+	).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("a", "1")
+	enc.AddString("a", "2")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := `{"level":"info","a":"2"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
+
+// TestWriteEntry_JSONFieldOrderAndExclude mirrors
+// TestWriteEntry_FieldOrderAndExclude for the JSON path: custom
+// TextFieldOrder is honored, a field outside the order is appended
+// afterward, and TextPartsExclude drops a field regardless of order.
+func TestWriteEntry_JSONFieldOrderAndExclude(t *testing.T) {
+	enc := NewColorEncoder(
+		TextForceColor(true),
+		TextFallbackJSON(true),
+		TextNoTime(),
+		TextFieldOrder([]string{"message", "level", "b"}),
+		TextPartsExclude([]string{"c"}),
+	).(*textEncoder)
+	defer enc.Free()
+
+	enc.AddString("b", "B")
+	enc.AddString("a", "A")
+	enc.AddString("c", "C")
+
+	var buf bytes.Buffer
+	if err := enc.WriteEntry(&buf, "msg", zap.InfoLevel, time.Time{}); err != nil {
+		t.Fatalf("WriteEntry: %v", err)
+	}
+
+	want := `{"msg":"msg","level":"info","b":"B","a":"A"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteEntry output = %q, want %q", got, want)
+	}
+}
+
+// TestAppendJSONString checks that control characters, quotes, and
+// backslashes are escaped, and that plain runs are copied through
+// untouched rather than escaped rune-by-rune.
+func TestAppendJSONString(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"plain", `"plain"`},
+		{"a\"b", `"a\"b"`},
+		{"a\\b", `"a\\b"`},
+		{"a\nb\tc\rd", `"a\nb\tc\rd"`},
+		{"a\x01b", "\"a\\u0001b\""},
+	}
+
+	for _, c := range cases {
+		buf := buffer.Get()
+		appendJSONString(buf, c.in)
+		if got := string(buf.Bytes()); got != c.want {
+			t.Errorf("appendJSONString(%q) = %q, want %q", c.in, got, c.want)
+		}
+		buffer.Put(buf)
+	}
+}
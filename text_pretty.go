@@ -0,0 +1,57 @@
+package zapcolors
+
+import "github.com/uber-go/zap"
+
+// TextLevelLabels overrides the label printed for one or more levels (the
+// default is the classic four-letter DEBG/INFO/WARN/ERRO/PANC/FATA set).
+// Levels not present in labels keep their default.
+func TextLevelLabels(labels map[zap.Level]string) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		if enc.levelLabels == nil {
+			enc.levelLabels = make(map[zap.Level]string, len(labels))
+		}
+		for lvl, label := range labels {
+			enc.levelLabels[lvl] = label
+		}
+	})
+}
+
+// TextFieldOrder fixes the order parts are rendered in. Entries "time",
+// "level", "caller", and "message" refer to the built-in header parts;
+// anything else is looked up as a field name. Fields present on the entry
+// but missing from order are appended afterward, in the order they were
+// added. "caller" is accepted for forward compatibility but is currently a
+// no-op, since this Encoder's WriteEntry isn't handed caller information.
+func TextFieldOrder(order []string) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		enc.fieldOrder = order
+	})
+}
+
+// TextFieldFormatter registers fn as the renderer for key, overriding the
+// default stringification. fn receives the value as the encoder stored it:
+// AddInt and AddInt64 hand fn an int64, AddUint and AddUint64 a uint64,
+// AddObject the object's %+v string, and AddMarshaler an unexported slice
+// of the nested fields.
+func TextFieldFormatter(key string, fn func(interface{}) string) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		if enc.formatters == nil {
+			enc.formatters = make(map[string]func(interface{}) string)
+		}
+		enc.formatters[key] = fn
+	})
+}
+
+// TextPartsExclude drops the named parts from the rendered line entirely.
+// Names are interpreted the same way as in TextFieldOrder: "time", "level",
+// "caller", "message", or a field name.
+func TextPartsExclude(names []string) TextOption {
+	return textOptionFunc(func(enc *textEncoder) {
+		if enc.exclude == nil {
+			enc.exclude = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			enc.exclude[name] = true
+		}
+	})
+}